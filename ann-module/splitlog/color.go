@@ -0,0 +1,92 @@
+package splitlog
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ANSI SGR codes used to color a level tag. They are only ever emitted
+// when the console sink has decided coloring is appropriate.
+const (
+	colorReset   = "\x1b[0m"
+	colorCyan    = "\x1b[36m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorRed     = "\x1b[31m"
+	colorBoldRed = "\x1b[1;31m"
+	colorMagenta = "\x1b[35m"
+	colorBlue    = "\x1b[34m"
+)
+
+// levelColors mirrors levels: DEBUG cyan, INFO green, WARN yellow,
+// ERROR red, FATAL bold red, READ magenta, UPDATE blue.
+var levelColors = []string{
+	colorCyan,
+	colorGreen,
+	colorYellow,
+	colorRed,
+	colorBoldRed,
+	colorMagenta,
+	colorBlue,
+}
+
+// consoleConfig bundles the stderr mirror installed by EnableConsole
+// with the settings mirrorConsole reads on every log call. It is
+// swapped in as a whole by EnableConsole, the same way SetOutput swaps
+// a Logger's writer, so mirrorConsole never sees a partially-updated
+// mix of the three.
+type consoleConfig struct {
+	logger *Logger
+	level  int
+	color  bool
+}
+
+// EnableConsole adds a stderr sink that mirrors every record at or
+// above level, in addition to the normal per-level on-disk files. When
+// color is true the level tag is wrapped in ANSI color codes, but only
+// if stderr is actually a terminal and NO_COLOR is not set - on-disk
+// files written through SetOutput are never colored. It may be called
+// at any point, concurrently with logging - the config is swapped in
+// atomically, the same way SetHandler swaps the Handler.
+func (l *Log) EnableConsole(level int, color bool) {
+	l.console.Store(&consoleConfig{
+		logger: New(os.Stderr, "", LstdFlags|Lmicroseconds),
+		level:  level,
+		color:  color && shouldColor(os.Stderr),
+	})
+}
+
+// shouldColor reports whether f is a terminal that should receive ANSI
+// color codes, honoring the NO_COLOR convention.
+func shouldColor(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// mirrorConsole writes mesg to the console sink if one is enabled and
+// level clears its configured level, colorizing the leading level tag
+// when the config has color enabled.
+func (l *Log) mirrorConsole(level int, mesg string) {
+	cfg := l.console.Load()
+	if cfg == nil || level < cfg.level {
+		return
+	}
+	if cfg.color {
+		mesg = colorizeTag(level, mesg)
+	}
+	cfg.logger.Print(mesg)
+}
+
+// colorizeTag wraps the levels[level] tag at the start of mesg in its
+// corresponding ANSI color, leaving the rest of the line untouched.
+func colorizeTag(level int, mesg string) string {
+	tag := levels[level]
+	if !strings.HasPrefix(mesg, tag) {
+		return mesg
+	}
+	return levelColors[level] + tag + colorReset + mesg[len(tag):]
+}
@@ -0,0 +1,82 @@
+package splitlog
+
+import (
+	"context"
+	"time"
+)
+
+// LevelStats reports how many records at a given level have passed
+// through putMesg since the Log was created.
+type LevelStats struct {
+	Enqueued int64 // accepted onto mesgCh
+	Dropped  int64 // dropped because mesgCh was full
+}
+
+// Stats reports the Log's message queue health: how full mesgCh
+// currently is, and per-level enqueued/dropped counts.
+type Stats struct {
+	QueueDepth int
+	Levels     map[string]LevelStats // keyed by the lowercase level name, e.g. "info"
+}
+
+// Stats returns a snapshot of the Log's queue depth and per-level
+// enqueued/dropped counters.
+func (l *Log) Stats() Stats {
+	levelStats := make(map[string]LevelStats, len(levelNames))
+	for i, name := range levelNames {
+		levelStats[name] = LevelStats{
+			Enqueued: l.counters.enqueued[i].Load(),
+			Dropped:  l.counters.dropped[i].Load(),
+		}
+	}
+	return Stats{
+		QueueDepth: len(l.mesgCh),
+		Levels:     levelStats,
+	}
+}
+
+// Flush waits for every message accepted before the call to actually be
+// written by GetMesg, then syncs every on-disk Logger, so that by the
+// time it returns nil those messages are durably on disk. It returns
+// ctx.Err() if ctx is done first.
+//
+// It waits on the completed counter rather than on mesgCh's length:
+// GetMesg removes a message from the channel before dispatch writes
+// it, so an empty channel doesn't mean the last write has happened yet.
+func (l *Log) Flush(ctx context.Context) error {
+	var target int64
+	for i := range l.counters.enqueued {
+		target += l.counters.enqueued[i].Load()
+	}
+
+	for l.counters.completed.Load() < target {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	for _, lg := range []*Logger{l.debug, l.info, l.warn, l.err, l.read, l.update} {
+		if err := lg.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes any buffered messages to disk and stops the GetMesg
+// goroutine. It is safe to call more than once. Applications embedding
+// a Log should call Close during shutdown so buffered lines aren't
+// lost when the process exits.
+func (l *Log) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = l.Flush(ctx)
+		close(l.closeCh)
+		<-l.doneCh
+	})
+	return err
+}
@@ -6,8 +6,9 @@ import (
 	"io"
 	"os"
 	"runtime"
-	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,19 +23,28 @@ const (
 	Lmicroseconds                 // microsecond resolution: 01:23:23.123123.  assumes Ltime.
 	Llongfile                     // full file name and line number: /a/b/c/d.go:23
 	Lshortfile                    // final file name element and line number: d.go:23. overrides Llongfile
+	Lmsgprefix                    // move the "prefix" from the beginning of the line to before the message
 	LstdFlags     = Ldate | Ltime // initial values for the standard logger
 )
 
+// atomicWriter pairs the writer currently in use with the io.Closer (if
+// any) that owns it, so a replaced writer can still be closed once it is
+// safe to do so.
+type atomicWriter struct {
+	w io.Writer
+	c io.Closer
+}
+
 // A logger represents an active logging object that generates lines of
 // output to an io.Writer.  Each logging operation makes a single call to
 // the Writer's Write method.  A logger can be used simultaneously from
 // multiple goroutines; it guarantees to serialize access to the Writer.
 type Logger struct {
-	mu     sync.Mutex     // ensures atomic writes; protects the following fields
-	prefix string         // prefix to write at beginning of each line
-	flag   int            // properties
-	out    io.WriteCloser // destination for output
-	buf    []byte         // for accumulating text to write
+	mu     sync.Mutex                   // serializes header/message buffer assembly
+	prefix string                       // prefix to write at beginning of each line
+	flag   int                          // properties
+	out    atomic.Pointer[atomicWriter] // destination for output, swapped without locking mu
+	buf    []byte                       // for accumulating text to write
 }
 
 // New creates a new logger.   The out variable sets the
@@ -42,7 +52,9 @@ type Logger struct {
 // The prefix appears at the beginning of each generated log line.
 // The flag argument defines the logging properties.
 func New(out io.WriteCloser, prefix string, flag int) *Logger {
-	return &Logger{out: out, prefix: prefix, flag: flag}
+	l := &Logger{prefix: prefix, flag: flag}
+	l.out.Store(&atomicWriter{w: out, c: out})
+	return l
 }
 
 var std = New(os.Stderr, "", LstdFlags)
@@ -68,7 +80,9 @@ func itoa(buf *[]byte, i int, wid int) {
 }
 
 func (l *Logger) formatHeader(buf *[]byte, t time.Time, file string, line int) {
-	*buf = append(*buf, l.prefix...)
+	if l.flag&Lmsgprefix == 0 {
+		*buf = append(*buf, l.prefix...)
+	}
 	if l.flag&(Ldate|Ltime|Lmicroseconds) != 0 {
 		if l.flag&Ldate != 0 {
 			year, month, day := t.Date()
@@ -121,26 +135,36 @@ func (l *Logger) Output(calldepth int, s string) error {
 	now := time.Now() // get this early.
 	var file string
 	var line int
-	l.mu.Lock()
-	defer l.mu.Unlock()
 	if l.flag&(Lshortfile|Llongfile) != 0 {
-		// release lock while getting caller info - it's expensive.
-		l.mu.Unlock()
+		// caller info is expensive to fetch - do it before taking mu.
 		var ok bool
 		_, file, line, ok = runtime.Caller(calldepth)
 		if !ok {
 			file = "???"
 			line = 0
 		}
-		l.mu.Lock()
 	}
+
+	l.mu.Lock()
 	l.buf = l.buf[:0]
 	l.formatHeader(&l.buf, now, file, line)
+	if l.flag&Lmsgprefix != 0 {
+		l.buf = append(l.buf, l.prefix...)
+	}
 	l.buf = append(l.buf, s...)
 	if len(s) > 0 && s[len(s)-1] != '\n' {
 		l.buf = append(l.buf, '\n')
 	}
-	_, err := l.out.Write(l.buf)
+	out := append([]byte(nil), l.buf...)
+	l.mu.Unlock()
+
+	// The write itself runs against whatever writer is currently
+	// installed, loaded atomically so it never contends with mu.
+	aw := l.out.Load()
+	if aw == nil || aw.w == nil {
+		return errors.New("splitlog: Output called on logger with no output set")
+	}
+	_, err := aw.w.Write(out)
 	return err
 }
 
@@ -226,23 +250,44 @@ func (l *Logger) SetPrefix(prefix string) {
 }
 
 // SetOutput re-sets the output destination - by JFS team
+//
+// It does not take mu: the writer is swapped atomically so in-flight
+// Output calls either see the old writer or the new one, never a torn
+// value, and callers of Output never block behind a SetOutput. Any
+// previously-installed io.Closer is closed after the swap for
+// compatibility with the old close-on-replace behavior.
 func (l *Logger) SetOutput(w io.WriteCloser) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.out != nil {
-		l.out.Close()
+	old := l.out.Swap(&atomicWriter{w: w, c: w})
+	if old != nil && old.c != nil {
+		old.c.Close()
+	}
+}
+
+// Writer returns the writer currently installed as the logger's output.
+func (l *Logger) Writer() io.Writer {
+	aw := l.out.Load()
+	if aw == nil {
+		return nil
 	}
-	l.out = w
+	return aw.w
+}
 
+// Sync flushes the logger's current output to stable storage, if the
+// underlying writer supports it.
+func (l *Logger) Sync() error {
+	aw := l.out.Load()
+	if aw == nil || aw.w == nil {
+		return nil
+	}
+	if s, ok := aw.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
 }
 
 // SetOutput sets the output destination for the standard logger.
 func SetOutput(w io.WriteCloser) {
-	std.mu.Lock()
-	defer std.mu.Unlock()
-	std.out.Close()
-	std.out = w
-
+	std.SetOutput(w)
 }
 
 // Flags returns the output flags for the standard logger.
@@ -335,11 +380,54 @@ type Log struct {
 	update *Logger
 
 	level  int
-	mesgCh chan string
+	mesgCh chan mesgItem
+
+	// handler is held behind a pointer to atomic.Pointer (rather than an
+	// embedded Handler or atomic.Pointer value) for the same reason
+	// rotate is: Log must stay copyable so With can return a derived
+	// *Log that shares it with l, and SetHandler can race format
+	// reading it on every log call.
+	handler *atomic.Pointer[Handler] // renders Records into lines, swapped by SetHandler; nil defaults to TextHandler
+	attrs   []Attr                   // structured attributes attached by With, carried onto every record
+
+	// rotate is held behind a pointer to atomic.Pointer (rather than an
+	// embedded RotateConfig or atomic.Pointer value) for the same reason
+	// counters/closeOnce are: Log must stay copyable so With can return
+	// a derived *Log that shares it with l, and SetRotateConfig can race
+	// checkLogRotation/checkSizeRotation reading it every tick.
+	rotate *atomic.Pointer[RotateConfig] // size/age/backup rotation policy, swapped by SetRotateConfig; nil keeps the old daily-only behavior
+	files  []*rotEntry                   // loggers paired with the on-disk path they write to, used for rotation
+
+	// console is held behind a pointer to atomic.Pointer for the same
+	// reason handler/rotate are: EnableConsole can race mirrorConsole
+	// reading it on every log call, and Log must stay copyable so With
+	// can return a derived *Log that shares it with l.
+	console *atomic.Pointer[consoleConfig] // stderr mirror installed by EnableConsole; nil disables it
+
+	// counters and closeOnce are held behind pointers (rather than
+	// embedded atomic.Int64/sync.Once values) so that Log remains
+	// copyable - With returns a derived *Log that shares them with l.
+	counters  *levelCounters
+	closeOnce *sync.Once
+
+	closeCh chan struct{} // closed by Close to tell GetMesg to drain and stop
+	doneCh  chan struct{} // closed by GetMesg once it has stopped
 
 	startTime time.Time
 }
 
+// levelCounters tracks, per level, how many records putMesg has
+// accepted onto mesgCh versus dropped because it was full, plus how
+// many of the accepted ones GetMesg has actually finished writing.
+// Flush waits on completed rather than on mesgCh's length, since a
+// message is removed from the channel before dispatch writes it -
+// draining the channel doesn't mean the write has happened yet.
+type levelCounters struct {
+	enqueued  [7]atomic.Int64
+	dropped   [7]atomic.Int64
+	completed atomic.Int64
+}
+
 var levels = []string{
 	"[DEBUG]",
 	"[INFO.]",
@@ -393,11 +481,19 @@ func NewLog(dir, module string, level int) (*Log, error) {
 	if err != nil {
 		return nil, err
 	}
-	glog.mesgCh = make(chan string, 102400)
+	glog.mesgCh = make(chan mesgItem, 102400)
+	glog.closeCh = make(chan struct{})
+	glog.doneCh = make(chan struct{})
+	glog.counters = &levelCounters{}
+	glog.closeOnce = &sync.Once{}
+	glog.handler = &atomic.Pointer[Handler]{}
+	glog.rotate = &atomic.Pointer[RotateConfig]{}
+	glog.console = &atomic.Pointer[consoleConfig]{}
 
 	glog.startTime = time.Now()
 
 	go glog.checkLogRotation(dir, module)
+	go glog.checkSizeRotation()
 	go glog.GetMesg()
 
 	return glog, nil
@@ -425,6 +521,7 @@ func (l *Log) initLog(logDir, module string, level int) error {
 		if *logHandles[i], err = getNewLog(logNames[i], logStr[i]+"LogFileOpenFailed"); err != nil {
 			return err
 		}
+		l.files = append(l.files, &rotEntry{path: logDir + "/" + module + logNames[i], lg: *logHandles[i]})
 	}
 
 	l.level = level
@@ -433,103 +530,124 @@ func (l *Log) initLog(logDir, module string, level int) error {
 }
 
 func Debug(s string) {
-	_, file, line, ok := runtime.Caller(2)
-	if !ok {
-		line = 0
-	}
-	short := file
-	for i := len(file) - 1; i > 0; i-- {
-		if file[i] == '/' {
-			short = file[i+1:]
-			break
-		}
-	}
-	file = short
-	fmt.Printf(file + ":" + strconv.Itoa(line) + " " + s)
+	fmt.Printf(callerInfo(2) + " " + s)
 }
 
 func (l *Log) SetPrefix(s, level string) string {
-	_, file, line, ok := runtime.Caller(2)
-	if !ok {
-		line = 0
-	}
-	short := file
-	for i := len(file) - 1; i > 0; i-- {
-		if file[i] == '/' {
-			short = file[i+1:]
-			break
-		}
-	}
-	file = short
+	return level + " " + callerInfo(2) + ": " + s
+}
 
-	return level + " " + file + ":" + strconv.Itoa(line) + ": " + s
+// mesgItem is what flows through mesgCh: the rendered line plus the
+// level it was logged at, kept alongside the text rather than sniffed
+// back out of it so GetMesg can route any Handler's output - not just
+// TextHandler's "[LEVEL] ..." lines.
+type mesgItem struct {
+	level int
+	text  string
 }
 
+// putMesg enqueues mesg for level without ever blocking the caller: if
+// mesgCh is full - the single GetMesg consumer stalled on a disk hiccup
+// or rotation - the message is dropped and counted rather than backing
+// up every LogInfo/LogWarn/etc. caller in the process.
 func (l *Log) putMesg(mesg string, level int) {
-	if level >= l.level {
-		l.mesgCh <- mesg
+	if level < l.level {
+		return
+	}
+	select {
+	case l.mesgCh <- mesgItem{level: level, text: mesg}:
+		l.counters.enqueued[level].Add(1)
+	default:
+		l.counters.dropped[level].Add(1)
 	}
 }
 
+// sprintMsg joins v the way fmt.Sprintln does but without the trailing
+// newline, since the record pipeline's Handler is what decides line
+// endings.
+func sprintMsg(v ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(v...), "\n")
+}
+
 func (l *Log) LogWarn(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[2])
-	l.putMesg(s, WarnLevel)
+	l.log(WarnLevel, 4, sprintMsg(v...), nil)
 }
 
 func (l *Log) LogInfo(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[1])
-	l.putMesg(s, InfoLevel)
+	l.log(InfoLevel, 4, sprintMsg(v...), nil)
 }
 
 func (l *Log) LogError(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[3])
-	l.putMesg(s, ErrorLevel)
+	l.log(ErrorLevel, 4, sprintMsg(v...), nil)
 }
 
 func (l *Log) LogDebug(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[0])
-	l.putMesg(s, DebugLevel)
+	l.log(DebugLevel, 4, sprintMsg(v...), nil)
 }
 
 func (l *Log) LogFatal(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[4])
+	s := l.format(FatalLevel, 3, sprintMsg(v...), nil)
 	l.err.Output(2, s)
+	// Write synchronously, bypassing mesgCh/GetMesg, since os.Exit below
+	// gives the async pipeline no chance to drain this one.
+	l.mirrorConsole(FatalLevel, s)
 	os.Exit(1)
 }
 
 func (l *Log) LogRead(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[5])
-	l.putMesg(s, ReadLevel)
+	l.log(ReadLevel, 4, sprintMsg(v...), nil)
 }
 
 func (l *Log) LogWrite(v ...interface{}) {
-	s := fmt.Sprintln(v...)
-	s = l.SetPrefix(s, levels[6])
-	l.putMesg(s, UpdateLevel)
+	l.log(UpdateLevel, 4, sprintMsg(v...), nil)
+}
+
+// dispatch routes item to its level's on-disk Logger and the console
+// mirror, keyed by item.level - never by sniffing item.text, since a
+// Handler other than TextHandler (e.g. JSONHandler) won't have the
+// "[LEVEL] ..." tag dispatch used to look for.
+func (l *Log) dispatch(item mesgItem) {
+	switch item.level {
+	case WarnLevel:
+		l.warn.Print(item.text)
+		l.mirrorConsole(WarnLevel, item.text)
+	case InfoLevel:
+		l.info.Print(item.text)
+		l.mirrorConsole(InfoLevel, item.text)
+	case DebugLevel:
+		l.debug.Print(item.text)
+		l.mirrorConsole(DebugLevel, item.text)
+	case ErrorLevel:
+		l.err.Print(item.text)
+		l.mirrorConsole(ErrorLevel, item.text)
+	case ReadLevel:
+		l.read.Print(item.text)
+		l.mirrorConsole(ReadLevel, item.text)
+	case UpdateLevel:
+		l.update.Print(item.text)
+		l.mirrorConsole(UpdateLevel, item.text)
+	}
+	l.counters.completed.Add(1)
 }
 
+// GetMesg drains mesgCh and dispatches each message to its level's
+// Logger until Close signals closeCh, at which point it drains
+// whatever is still queued before exiting and closing doneCh.
 func (l *Log) GetMesg() {
+	defer close(l.doneCh)
 	for {
-		mesg := <-l.mesgCh
-		switch mesg[1] {
-		case 'W':
-			l.warn.Print(mesg)
-		case 'I':
-			l.info.Print(mesg)
-		case 'D':
-			l.debug.Print(mesg)
-		case 'E':
-			l.err.Print(mesg)
-		case 'R':
-			l.read.Print(mesg)
-		case 'U':
-			l.update.Print(mesg)
+		select {
+		case item := <-l.mesgCh:
+			l.dispatch(item)
+		case <-l.closeCh:
+			for {
+				select {
+				case item := <-l.mesgCh:
+					l.dispatch(item)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
@@ -544,28 +662,37 @@ func (l *Log) checkLogRotation(logDir, module string) {
 			continue
 		}
 
-		setLogRotation := func(logFileName string, setLog *Logger) error {
-			logFilePath := logDir + "/" + module + logFileName
-			err := os.Rename(logFilePath, logFilePath+"."+yesterday.Format(LogFileNameDateFormat))
+		cfg := l.rotateConfig()
+
+		// setLogRotation locks f.mu so it can't race checkSizeRotation
+		// rotating the same path out from under it.
+		setLogRotation := func(f *rotEntry) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+
+			backupPath := f.path + "." + yesterday.Format(LogFileNameDateFormat)
+			err := os.Rename(f.path, backupPath)
 			if err != nil {
 				return err
 			}
-			fp, err := os.OpenFile(logFilePath, LogFileOpt, 0666)
+			fp, err := os.OpenFile(f.path, LogFileOpt, 0666)
 			if err != nil {
 				return err
 			}
 
-			setLog.SetOutput(fp)
+			f.lg.SetOutput(fp)
+
+			if cfg.Compress {
+				go compressFile(backupPath)
+			}
+			l.pruneBackups(f.path, cfg)
 
 			return err
 		}
 
 		//rotate the log files
-		setLogRotation(DebugLogFileName, l.debug)
-		setLogRotation(InfoLogFileName, l.info)
-		setLogRotation(WarnLogFileName, l.warn)
-		setLogRotation(ErrLogFileName, l.err)
-		setLogRotation(ReadLogFileName, l.read)
-		setLogRotation(UpdateLogFileName, l.update)
+		for _, f := range l.files {
+			setLogRotation(f)
+		}
 	}
 }
@@ -0,0 +1,92 @@
+package splitlog
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestFlushWaitsForConcurrentLogs exercises Flush/Close after several
+// goroutines have called LogInfo concurrently, the scenario the completed
+// counter in Flush was added to get right: Flush must not return until
+// every message accepted before the call has actually been dispatched.
+func TestFlushWaitsForConcurrentLogs(t *testing.T) {
+	l, err := NewLog(t.TempDir(), "flushtest", InfoLevel)
+	if err != nil {
+		t.Fatalf("NewLog: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				l.LogInfo("hello")
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := l.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	stats := l.Stats()
+	if got := stats.Levels["info"].Enqueued; got != 400 {
+		t.Fatalf("enqueued = %d, want 400", got)
+	}
+	if got := l.counters.completed.Load(); got != 400 {
+		t.Fatalf("completed after Flush = %d, want 400", got)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// TestConcurrentConfigWithLogging calls SetRotateConfig, SetHandler and
+// EnableConsole concurrently with LogInfo. It doesn't assert on
+// behavior; run with -race, it catches the class of bug fixed alongside
+// this test, where those setters raced the background rotator and the
+// format/mirrorConsole paths.
+func TestConcurrentConfigWithLogging(t *testing.T) {
+	l, err := NewLog(t.TempDir(), "configtest", InfoLevel)
+	if err != nil {
+		t.Fatalf("NewLog: %v", err)
+	}
+	defer l.Close()
+
+	stop := make(chan struct{})
+	var loggers sync.WaitGroup
+	loggers.Add(1)
+	go func() {
+		defer loggers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.LogInfo("hello")
+			}
+		}
+	}()
+
+	var setters sync.WaitGroup
+	setters.Add(1)
+	go func() {
+		defer setters.Done()
+		for i := 0; i < 50; i++ {
+			l.SetRotateConfig(RotateConfig{MaxSizeBytes: 1 << 20})
+			l.SetHandler(JSONHandler{})
+			l.EnableConsole(InfoLevel, true)
+		}
+	}()
+	setters.Wait()
+
+	close(stop)
+	loggers.Wait()
+}
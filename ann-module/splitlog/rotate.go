@@ -0,0 +1,178 @@
+package splitlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateConfig bounds how large and how many on-disk log segments a
+// Log is allowed to accumulate. The zero value disables all of it,
+// leaving the original once-a-day rename as the only rotation.
+type RotateConfig struct {
+	MaxSizeBytes int64 // rotate a level's file once it exceeds this size; 0 disables size-based rotation
+	MaxAgeDays   int   // delete rotated segments older than this many days; 0 disables age pruning
+	MaxBackups   int   // keep at most this many rotated segments per level; 0 disables count pruning
+	Compress     bool  // gzip a segment once it is rotated out
+}
+
+// rotEntry pairs a level's Logger with the on-disk path it currently
+// writes to, so the background rotator can stat and replace it. mu
+// serializes rotation of that one path: checkLogRotation's daily pass
+// and checkSizeRotation's size-triggered pass both rotate by path, and
+// without this lock the two could race on the same rename+reopen,
+// producing duplicate or near-empty backup segments.
+type rotEntry struct {
+	path string
+	lg   *Logger
+	mu   sync.Mutex
+}
+
+// sizeRotationTimeFormat disambiguates same-day size-triggered rotations,
+// unlike the daily rotation's day-granularity suffix.
+const sizeRotationTimeFormat = "20060102-150405.000000"
+
+// SetRotateConfig installs the rotation policy used by the background
+// rotator started in NewLog. It may be called at any point after
+// NewLog, concurrently with logging or an in-flight rotation - the
+// policy is swapped in atomically and takes effect within one tick.
+func (l *Log) SetRotateConfig(cfg RotateConfig) {
+	l.rotate.Store(&cfg)
+}
+
+// rotateConfig returns the currently installed RotateConfig, or the
+// zero value (all rotation triggers disabled) if SetRotateConfig has
+// never been called.
+func (l *Log) rotateConfig() RotateConfig {
+	cfg := l.rotate.Load()
+	if cfg == nil {
+		return RotateConfig{}
+	}
+	return *cfg
+}
+
+// checkSizeRotation periodically rotates any level's file once it grows
+// past MaxSizeBytes. It runs for the lifetime of the Log; when
+// MaxSizeBytes is unset it just idles.
+func (l *Log) checkSizeRotation() {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		cfg := l.rotateConfig()
+		if cfg.MaxSizeBytes <= 0 {
+			continue
+		}
+		for _, f := range l.files {
+			l.rotateIfOversize(f, cfg)
+		}
+	}
+}
+
+func (l *Log) rotateIfOversize(f *rotEntry, cfg RotateConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil || fi.Size() <= cfg.MaxSizeBytes {
+		return
+	}
+
+	backupPath := f.path + "." + time.Now().Format(sizeRotationTimeFormat)
+	if err := os.Rename(f.path, backupPath); err != nil {
+		return
+	}
+	fp, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return
+	}
+
+	// SetOutput swaps the atomic writer pointer, so this is safe
+	// against concurrent Output calls on f.lg.
+	f.lg.SetOutput(fp)
+
+	if cfg.Compress {
+		go compressFile(backupPath)
+	}
+	l.pruneBackups(f.path, cfg)
+}
+
+// compressFile gzips path to path+".gz" and removes the original. It is
+// run in its own goroutine so a slow compress never blocks rotation.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		gw.Close()
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// pruneBackups deletes rotated segments of basePath (both the plain and
+// the .gz form) that are older than cfg.MaxAgeDays or that exceed
+// cfg.MaxBackups, oldest first. Both limits are optional.
+func (l *Log) pruneBackups(basePath string, cfg RotateConfig) {
+	if cfg.MaxAgeDays <= 0 && cfg.MaxBackups <= 0 {
+		return
+	}
+
+	dir := filepath.Dir(basePath)
+	base := filepath.Base(basePath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var backups []os.DirEntry
+	for _, e := range entries {
+		if e.Name() == base || !strings.HasPrefix(e.Name(), base+".") {
+			continue
+		}
+		backups = append(backups, e)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		ii, _ := backups[i].Info()
+		jj, _ := backups[j].Info()
+		return ii.ModTime().Before(jj.ModTime())
+	})
+
+	if cfg.MaxAgeDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -cfg.MaxAgeDays)
+		remaining := backups[:0]
+		for _, e := range backups {
+			info, err := e.Info()
+			if err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(filepath.Join(dir, e.Name()))
+				continue
+			}
+			remaining = append(remaining, e)
+		}
+		backups = remaining
+	}
+
+	if cfg.MaxBackups > 0 && len(backups) > cfg.MaxBackups {
+		for _, e := range backups[:len(backups)-cfg.MaxBackups] {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}